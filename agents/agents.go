@@ -0,0 +1,348 @@
+// Package agents отвечает за генерацию правдоподобных User-Agent строк.
+//
+// Вместо статического списка из нескольких строк пакет периодически
+// скачивает данные о реальной доле использования версий браузеров
+// (fulldata из caniuse) и выбирает версию Chrome пропорционально её
+// доле рынка. Под выбранную версию подбирается согласованный набор
+// значений navigator (platform/languages/plugins), который нужно
+// внедрить через context.AddInitScript, чтобы JS-отпечаток страницы не
+// противоречил заголовку User-Agent.
+//
+// Пакет намеренно выбирает только из семейства Chrome/Chromium: сам
+// парсер всегда запускает pw.Chromium.Launch, и подмена User-Agent на
+// другой движок (например, Firefox) не поменяла бы реальный движок —
+// navigator.userAgent, window.chrome и остальные Chromium-специфичные
+// тells остались бы на месте и сделали бы отпечаток более заметным, а
+// не менее.
+package agents
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const caniuseURL = "https://raw.githubusercontent.com/Fyrd/caniuse/master/fulldata-json/data-2.0.json"
+
+const cacheFileName = "ua_cache.json"
+
+// InitHints описывает значения navigator, которые должны совпадать с
+// выбранным User-Agent, чтобы не выдать подмену в JS-отпечатке.
+type InitHints struct {
+	Platform  string   `json:"platform"`
+	Languages []string `json:"languages"`
+	Plugins   int      `json:"plugins"`
+}
+
+// browserVersion — одна версия браузера с её долей использования.
+type browserVersion struct {
+	Browser string
+	Version string
+	Share   float64
+}
+
+type osEntry struct {
+	token  string
+	weight float64
+}
+
+var osTable = map[string][]osEntry{
+	"chrome": {
+		{token: "Windows NT 10.0; Win64; x64", weight: 0.62},
+		{token: "Macintosh; Intel Mac OS X 10_15_7", weight: 0.23},
+		{token: "X11; Linux x86_64", weight: 0.15},
+	},
+}
+
+var platformByOSToken = map[string]string{
+	"Windows NT 10.0; Win64; x64":       "Win32",
+	"Macintosh; Intel Mac OS X 10_15_7": "MacIntel",
+	"X11; Linux x86_64":                 "Linux x86_64",
+}
+
+// fallbackVersions используется, если не удалось ни скачать, ни
+// прочитать кэш свежих данных о версиях.
+var fallbackVersions = []browserVersion{
+	{Browser: "chrome", Version: "124.0.0.0", Share: 0.45},
+	{Browser: "chrome", Version: "123.0.0.0", Share: 0.2},
+}
+
+// Pool хранит закэшированные доли версий браузеров и умеет выбирать
+// из них случайную пару браузер+версия с учётом веса.
+type Pool struct {
+	mu          sync.Mutex
+	versions    []browserVersion
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	ttl         time.Duration
+	cacheDir    string
+	httpClient  *http.Client
+}
+
+var (
+	defaultPool     *Pool
+	defaultPoolOnce sync.Once
+)
+
+// NewPool создаёт пул с заданным TTL кэша и директорией, куда
+// сохраняется скачанный снапшот (для переживания холодного старта).
+func NewPool(ttl time.Duration, cacheDir string) *Pool {
+	return &Pool{
+		ttl:        ttl,
+		cacheDir:   cacheDir,
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func defaultPoolInstance() *Pool {
+	defaultPoolOnce.Do(func() {
+		defaultPool = NewPool(24*time.Hour, ".")
+	})
+	return defaultPool
+}
+
+// defaultRefreshHours — TTL кэша версий браузеров, если конфигурация
+// не задаёт user_agent_refresh_hours (в том числе в старых config.json,
+// где этого поля ещё не было — JSON-декодер оставит его нулём).
+const defaultRefreshHours = 24
+
+// Configure задаёт TTL кэша версий браузеров для пула по умолчанию,
+// используемого функцией Pick. Вызывать до первого Pick, иначе
+// применится при следующем истечении текущего TTL. refreshHours <= 0
+// означает "использовать значение по умолчанию", а не "обновлять при
+// каждом обращении".
+func Configure(refreshHours int) {
+	if refreshHours <= 0 {
+		refreshHours = defaultRefreshHours
+	}
+
+	p := defaultPoolInstance()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ttl = time.Duration(refreshHours) * time.Hour
+}
+
+// Pick выбирает браузер+версию, взвешенные по глобальной доле
+// использования, и возвращает готовую строку User-Agent вместе с
+// согласованными подсказками для navigator.
+func Pick() (string, InitHints) {
+	return defaultPoolInstance().Pick()
+}
+
+// Refresh принудительно обновляет кэш версий браузеров.
+func Refresh() error {
+	return defaultPoolInstance().refresh()
+}
+
+// Pick выбирает браузер+версию из пула p.
+func (p *Pool) Pick() (string, InitHints) {
+	p.mu.Lock()
+	if time.Since(p.lastAttempt) > p.ttl {
+		// Не страшно, если обновление не удалось: используем то, что
+		// уже есть (или fallback), и попробуем снова не раньше, чем
+		// истечёт следующий TTL (см. refresh — lastAttempt обновляется
+		// при каждой попытке, а не только при успехе).
+		p.mu.Unlock()
+		_ = p.refresh()
+		p.mu.Lock()
+	}
+	versions := p.versions
+	p.mu.Unlock()
+
+	if len(versions) == 0 {
+		versions = fallbackVersions
+	}
+
+	bv := weightedPick(versions)
+	osToken := pickOSToken(bv.Browser)
+	ua := buildUA(bv, osToken)
+	hints := InitHints{
+		Platform:  platformByOSToken[osToken],
+		Languages: []string{"ru-RU", "ru", "en-US", "en"},
+		Plugins:   3,
+	}
+
+	return ua, hints
+}
+
+func buildUA(bv browserVersion, osToken string) string {
+	return fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%s Safari/537.36", osToken, bv.Version)
+}
+
+func pickOSToken(browser string) string {
+	entries, ok := osTable[browser]
+	if !ok {
+		entries = osTable["chrome"]
+	}
+
+	var total float64
+	for _, e := range entries {
+		total += e.weight
+	}
+
+	r := rand.Float64() * total
+	var cum float64
+	for _, e := range entries {
+		cum += e.weight
+		if r <= cum {
+			return e.token
+		}
+	}
+	return entries[len(entries)-1].token
+}
+
+// weightedPick выбирает одну версию, используя выборку по кумулятивному
+// распределению долей использования.
+func weightedPick(versions []browserVersion) browserVersion {
+	var total float64
+	for _, v := range versions {
+		total += v.Share
+	}
+	if total <= 0 {
+		return versions[rand.Intn(len(versions))]
+	}
+
+	r := rand.Float64() * total
+	var cum float64
+	for _, v := range versions {
+		cum += v.Share
+		if r <= cum {
+			return v
+		}
+	}
+	return versions[len(versions)-1]
+}
+
+// --- caniuse fetch/cache ---
+
+type caniuseData struct {
+	Agents map[string]struct {
+		Browser     string             `json:"browser"`
+		UsageGlobal map[string]float64 `json:"usage_global"`
+	} `json:"agents"`
+}
+
+type cacheFile struct {
+	FetchedAt time.Time        `json:"fetched_at"`
+	Versions  []browserVersion `json:"versions"`
+}
+
+func (p *Pool) cachePath() string {
+	return filepath.Join(p.cacheDir, cacheFileName)
+}
+
+func (p *Pool) refresh() error {
+	versions, err := p.fetchFromNetwork()
+	now := time.Now()
+	if err != nil {
+		if cached, cacheErr := p.loadFromDisk(); cacheErr == nil {
+			p.mu.Lock()
+			p.versions = cached.Versions
+			p.fetchedAt = cached.FetchedAt
+			p.lastAttempt = now
+			p.mu.Unlock()
+			return nil
+		}
+
+		p.mu.Lock()
+		if len(p.versions) == 0 {
+			p.versions = fallbackVersions
+			p.fetchedAt = now
+		}
+		p.lastAttempt = now
+		p.mu.Unlock()
+		return err
+	}
+
+	p.mu.Lock()
+	p.versions = versions
+	p.fetchedAt = now
+	p.lastAttempt = now
+	p.mu.Unlock()
+
+	_ = p.saveToDisk(cacheFile{FetchedAt: p.fetchedAt, Versions: versions})
+	return nil
+}
+
+func (p *Pool) fetchFromNetwork() ([]browserVersion, error) {
+	resp, err := p.httpClient.Get(caniuseURL)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось скачать данные caniuse: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("caniuse вернул неожиданный статус: %d", resp.StatusCode)
+	}
+
+	var data caniuseData
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("не удалось разобрать данные caniuse: %w", err)
+	}
+
+	var versions []browserVersion
+	for id, agent := range data.Agents {
+		browser := normalizeBrowser(id)
+		if browser == "" {
+			continue
+		}
+		for version, share := range agent.UsageGlobal {
+			if share <= 0 {
+				continue
+			}
+			versions = append(versions, browserVersion{
+				Browser: browser,
+				Version: version,
+				Share:   share,
+			})
+		}
+	}
+
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("caniuse не вернул ни одной версии браузера")
+	}
+
+	return versions, nil
+}
+
+// normalizeBrowser отображает идентификаторы браузеров из caniuse в
+// наши внутренние имена. Ограничено семейством Chrome/Chromium — см.
+// комментарий к пакету: это единственный движок, который реально
+// запускается (pw.Chromium.Launch), подмена на другой браузер через UA
+// лишь ухудшила бы отпечаток.
+func normalizeBrowser(id string) string {
+	switch id {
+	case "chrome", "and_chr":
+		return "chrome"
+	default:
+		return ""
+	}
+}
+
+func (p *Pool) saveToDisk(cf cacheFile) error {
+	if p.cacheDir == "" {
+		return nil
+	}
+	data, err := json.Marshal(cf)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p.cachePath(), data, 0o644)
+}
+
+func (p *Pool) loadFromDisk() (cacheFile, error) {
+	var cf cacheFile
+	data, err := os.ReadFile(p.cachePath())
+	if err != nil {
+		return cf, err
+	}
+	if err := json.Unmarshal(data, &cf); err != nil {
+		return cf, err
+	}
+	return cf, nil
+}
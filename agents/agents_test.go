@@ -0,0 +1,92 @@
+package agents
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWeightedPickRespectsShare(t *testing.T) {
+	versions := []browserVersion{
+		{Browser: "chrome", Version: "1.0", Share: 0.9},
+		{Browser: "chrome", Version: "2.0", Share: 0.1},
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		counts[weightedPick(versions).Version]++
+	}
+
+	if counts["1.0"] <= counts["2.0"] {
+		t.Fatalf("expected version with higher share to be picked more often, got %v", counts)
+	}
+}
+
+func TestWeightedPickZeroShareFallsBackToUniform(t *testing.T) {
+	versions := []browserVersion{
+		{Browser: "chrome", Version: "1.0", Share: 0},
+		{Browser: "chrome", Version: "2.0", Share: 0},
+	}
+
+	// Просто не должно падать и должно вернуть одну из версий.
+	bv := weightedPick(versions)
+	if bv.Version != "1.0" && bv.Version != "2.0" {
+		t.Fatalf("unexpected version picked: %q", bv.Version)
+	}
+}
+
+func TestPickOSTokenUnknownBrowserFallsBackToChrome(t *testing.T) {
+	token := pickOSToken("unknown-browser")
+
+	found := false
+	for _, e := range osTable["chrome"] {
+		if e.token == token {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Fatalf("pickOSToken(%q) = %q, not a valid chrome OS token", "unknown-browser", token)
+	}
+}
+
+func TestConfigureDefaultsZeroRefreshHours(t *testing.T) {
+	Configure(0)
+	if got := defaultPoolInstance().ttl; got != defaultRefreshHours*time.Hour {
+		t.Fatalf("Configure(0): ttl = %v, want %v (default)", got, defaultRefreshHours*time.Hour)
+	}
+
+	Configure(1)
+	if got := defaultPoolInstance().ttl; got != time.Hour {
+		t.Fatalf("Configure(1): ttl = %v, want 1h", got)
+	}
+}
+
+// TestRefreshThrottlesRepeatedFailures воспроизводит баг из ревью: при
+// недоступной сети и отсутствии диск-кэша Pick не должен пытаться
+// скачать данные заново при каждом вызове внутри одного TTL-окна.
+func TestRefreshThrottlesRepeatedFailures(t *testing.T) {
+	var networkCalls int
+	p := NewPool(time.Hour, t.TempDir())
+	p.httpClient = &http.Client{
+		Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			networkCalls++
+			return nil, errors.New("сеть недоступна")
+		}),
+	}
+
+	for i := 0; i < 3; i++ {
+		p.Pick()
+	}
+
+	if networkCalls != 1 {
+		t.Fatalf("ожидалась 1 попытка сети на окно TTL, получено %d", networkCalls)
+	}
+}
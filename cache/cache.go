@@ -0,0 +1,116 @@
+// Package cache хранит последние известные позиции объявлений в
+// локальной SQLite-базе, чтобы повторные запуски парсера по
+// расписанию могли пропускать город, если для всех его объявлений уже
+// есть достаточно свежая запись (инкрементальный режим).
+package cache
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Entry — одна закэшированная позиция объявления в городе по запросу.
+type Entry struct {
+	CitySlug   string
+	Query      string
+	AdID       int
+	Position   string
+	ObservedAt time.Time
+}
+
+// Store — обёртка над SQLite-базой с позициями объявлений.
+type Store struct {
+	db *sql.DB
+}
+
+// Open открывает (создавая при необходимости) базу по пути path и
+// накатывает схему.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть кэш %s: %w", path, err)
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("не удалось применить схему кэша: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS positions (
+	city_slug   TEXT NOT NULL,
+	query       TEXT NOT NULL,
+	ad_id       INTEGER NOT NULL,
+	position    TEXT NOT NULL,
+	observed_at INTEGER NOT NULL,
+	PRIMARY KEY (city_slug, query, ad_id)
+);
+`
+
+// Close закрывает соединение с базой.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put сохраняет (или обновляет) позицию объявления adID для пары
+// city_slug/query, наблюдённую в момент observedAt.
+func (s *Store) Put(citySlug, query string, adID int, position string, observedAt time.Time) error {
+	_, err := s.db.Exec(`
+		INSERT INTO positions (city_slug, query, ad_id, position, observed_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (city_slug, query, ad_id) DO UPDATE SET
+			position = excluded.position,
+			observed_at = excluded.observed_at
+	`, citySlug, query, adID, position, observedAt.Unix())
+	return err
+}
+
+// FreshPositions возвращает позиции всех adIDs для city_slug/query,
+// если КАЖДЫЙ из них имеет запись не старше ttl. Если хотя бы одного
+// не хватает или он устарел, возвращает ok=false — город нужно
+// разобрать заново.
+func (s *Store) FreshPositions(citySlug, query string, adIDs []int, ttl time.Duration) (positions map[int]string, ok bool, err error) {
+	positions = make(map[int]string, len(adIDs))
+	cutoff := time.Now().Add(-ttl).Unix()
+
+	for _, adID := range adIDs {
+		var position string
+		var observedAt int64
+
+		row := s.db.QueryRow(`
+			SELECT position, observed_at FROM positions
+			WHERE city_slug = ? AND query = ? AND ad_id = ?
+		`, citySlug, query, adID)
+
+		switch err := row.Scan(&position, &observedAt); err {
+		case nil:
+			if observedAt < cutoff {
+				return nil, false, nil
+			}
+			positions[adID] = position
+		case sql.ErrNoRows:
+			return nil, false, nil
+		default:
+			return nil, false, fmt.Errorf("не удалось прочитать кэш для %s/%s/%d: %w", citySlug, query, adID, err)
+		}
+	}
+
+	return positions, true, nil
+}
+
+// GC удаляет записи старше maxAge вне зависимости от TTL
+// инкрементального режима, чтобы база не росла бесконечно.
+func (s *Store) GC(maxAge time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-maxAge).Unix()
+	res, err := s.db.Exec(`DELETE FROM positions WHERE observed_at < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось выполнить GC кэша: %w", err)
+	}
+	return res.RowsAffected()
+}
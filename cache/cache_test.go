@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "cache.sqlite"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestFreshPositionsMissingEntry(t *testing.T) {
+	s := openTestStore(t)
+
+	_, ok, err := s.FreshPositions("msk", "iphone", []int{1}, time.Hour)
+	if err != nil {
+		t.Fatalf("FreshPositions: %v", err)
+	}
+	if ok {
+		t.Fatalf("expected ok=false for a city/query never put into the cache")
+	}
+}
+
+func TestFreshPositionsAllWithinTTL(t *testing.T) {
+	s := openTestStore(t)
+	now := time.Now()
+
+	if err := s.Put("msk", "iphone", 1, "3", now); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put("msk", "iphone", 2, "7", now); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	positions, ok, err := s.FreshPositions("msk", "iphone", []int{1, 2}, time.Hour)
+	if err != nil {
+		t.Fatalf("FreshPositions: %v", err)
+	}
+	if !ok {
+		t.Fatalf("expected ok=true when all ad IDs are fresh")
+	}
+	if positions[1] != "3" || positions[2] != "7" {
+		t.Fatalf("unexpected positions: %v", positions)
+	}
+}
+
+func TestFreshPositionsOneStaleInvalidatesWholeCity(t *testing.T) {
+	s := openTestStore(t)
+
+	if err := s.Put("msk", "iphone", 1, "3", time.Now()); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put("msk", "iphone", 2, "7", time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	_, ok, err := s.FreshPositions("msk", "iphone", []int{1, 2}, time.Hour)
+	if err != nil {
+		t.Fatalf("FreshPositions: %v", err)
+	}
+	if ok {
+		t.Fatalf("expected ok=false when one of the ad IDs is older than ttl")
+	}
+}
+
+func TestFreshPositionsPartialAdIDCoverageIsNotFresh(t *testing.T) {
+	s := openTestStore(t)
+
+	if err := s.Put("msk", "iphone", 1, "3", time.Now()); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// Запрашиваем adID 2, для которого записи ещё нет.
+	_, ok, err := s.FreshPositions("msk", "iphone", []int{1, 2}, time.Hour)
+	if err != nil {
+		t.Fatalf("FreshPositions: %v", err)
+	}
+	if ok {
+		t.Fatalf("expected ok=false when not every requested ad ID has a cached entry")
+	}
+}
+
+func TestPutUpdatesExistingEntry(t *testing.T) {
+	s := openTestStore(t)
+
+	if err := s.Put("msk", "iphone", 1, "10", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put("msk", "iphone", 1, "4", time.Now()); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	positions, ok, err := s.FreshPositions("msk", "iphone", []int{1}, time.Hour)
+	if err != nil {
+		t.Fatalf("FreshPositions: %v", err)
+	}
+	if !ok || positions[1] != "4" {
+		t.Fatalf("expected updated position %q, got ok=%v positions=%v", "4", ok, positions)
+	}
+}
+
+func TestGCRemovesOnlyOldEntries(t *testing.T) {
+	s := openTestStore(t)
+
+	if err := s.Put("msk", "iphone", 1, "3", time.Now().Add(-48*time.Hour)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put("msk", "iphone", 2, "5", time.Now()); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	removed, err := s.GC(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("GC removed %d rows, want 1", removed)
+	}
+
+	if _, ok, err := s.FreshPositions("msk", "iphone", []int{2}, time.Hour); err != nil || !ok {
+		t.Fatalf("expected recent entry to survive GC: ok=%v err=%v", ok, err)
+	}
+}
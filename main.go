@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"math/rand"
+	"net/http"
 	"net/url"
 	"os"
 	"strconv"
@@ -13,16 +17,59 @@ import (
 	"time"
 
 	"github.com/playwright-community/playwright-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"avito-parser/agents"
+	"avito-parser/cache"
+	"avito-parser/proxypool"
+	"avito-parser/solver"
+	"avito-parser/tracing"
 )
 
+// logger — структурированный логгер пайплайна разбора, заменяет
+// точечные log.Printf в runWorker/parseCityWithRetry/parseCity.
+var logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+// tracer создаёт спаны жизненного цикла разбора города. Если
+// трейсинг не настроен (tracing.Init с пустым endpoint), эти спаны
+// создаются в no-op провайдере и ничего никуда не отправляют.
+var tracer = otel.Tracer("avito-parser")
+
+// spanTraceID возвращает trace ID span'а города для PositionResult.TraceID,
+// либо пустую строку, если трейсинг не настроен (no-op провайдер отдаёт
+// невалидный SpanContext) — иначе TraceID.String() вернул бы обманчивый
+// "нулевой" trace ID вида "00000000000000000000000000000000".
+func spanTraceID(span trace.Span) string {
+	if !span.SpanContext().IsValid() {
+		return ""
+	}
+	return span.SpanContext().TraceID().String()
+}
+
 type ConfigSettings struct {
-	Timeout    int      `json:"timeout"`
-	MaxWorkers int      `json:"max_workers"`
-	MinDelay   int      `json:"min_delay"`
-	MaxDelay   int      `json:"max_delay"`
-	Headless   bool     `json:"headless"`
-	Proxies    []string `json:"proxies"`
-	MaxRetries int      `json:"max_retries"`
+	Timeout               int          `json:"timeout"`
+	MaxWorkers            int          `json:"max_workers"`
+	MinDelay              int          `json:"min_delay"`
+	MaxDelay              int          `json:"max_delay"`
+	Headless              bool         `json:"headless"`
+	Proxies               []string     `json:"proxies"`
+	MaxRetries            int          `json:"max_retries"`
+	UserAgentRefreshHours int          `json:"user_agent_refresh_hours"`
+	Solver                SolverConfig `json:"solver"`
+	Incremental           bool         `json:"incremental"`
+	CachePath             string       `json:"cache_path"`
+	CacheTTLMinutes       int          `json:"cache_ttl_minutes"`
+	OTLPEndpoint          string       `json:"otlp_endpoint"`
+}
+
+// SolverConfig настраивает внешний сервис решения CAPTCHA/anti-bot
+// челленджей. Пустой Provider отключает решатель.
+type SolverConfig struct {
+	Provider string `json:"provider"`
+	APIKey   string `json:"api_key"`
+	Timeout  int    `json:"timeout"`
 }
 
 type InputData struct {
@@ -42,37 +89,52 @@ type PositionResult struct {
 	Error     string         `json:"error,omitempty"`
 	ProxyUsed string         `json:"proxy_used,omitempty"`
 	Blocked   bool           `json:"blocked,omitempty"`
-}
-
-var userAgents = []string{
-	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36",
-	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36",
-	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36",
+	FromCache bool           `json:"from_cache,omitempty"`
+	TraceID   string         `json:"trace_id,omitempty"`
 }
 
 func main() {
 	rand.New(rand.NewSource(time.Now().UnixNano()))
 	log.SetOutput(os.Stderr)
 
-	config, err := loadConfig("config.json")
+	if len(os.Args) > 1 && os.Args[1] == "server" {
+		runServerCommand(os.Args[2:])
+		return
+	}
+
+	runOnceCommand(os.Args[1:])
+}
+
+// runOnceCommand — поведение по умолчанию: читает InputData из stdin,
+// разбирает все города один раз и печатает результат в stdout.
+func runOnceCommand(args []string) {
+	fs := flag.NewFlagSet("avito-parser", flag.ExitOnError)
+	incremental := fs.Bool("incremental", false, "пропускать города, для которых все объявления уже есть в свежем кэше")
+	forceRefresh := fs.Bool("force-refresh", false, "игнорировать кэш и разобрать все города заново")
+	fs.Parse(args)
+
+	config := resolveConfig()
+	if *incremental {
+		config.Incremental = true
+	}
+
+	shutdownTracing, err := tracing.Init(config.OTLPEndpoint)
 	if err != nil {
-		log.Printf("Ошибка загрузки config.json: %v. Используются значения по умолчанию.", err)
-		config = getDefaultConfig()
+		log.Fatalf("Не удалось настроить трейсинг: %v", err)
 	}
+	defer shutdownTracing(context.Background())
+
+	cacheStore := setupCache(&config)
+	if cacheStore != nil {
+		defer cacheStore.Close()
+	}
+	slv := setupSolver(config)
 
 	inputData, err := loadInputData()
 	if err != nil {
 		log.Fatalf("Ошибка загрузки данных из stdin: %v", err)
 	}
 
-	cities := make([]City, len(inputData.Cities))
-	for i, citySlug := range inputData.Cities {
-		cities[i] = City{
-			Name: citySlug,
-			Slug: citySlug,
-		}
-	}
-
 	pw, err := playwright.Run()
 	if err != nil {
 		log.Fatalf("Не удалось запустить Playwright: %v", err)
@@ -87,16 +149,154 @@ func main() {
 	}
 	defer browser.Close()
 
-	cityGroups := distributeCities(cities, config.Proxies)
+	r := newRunner(browser, config, slv, cacheStore)
+	allResults := r.run(context.Background(), inputData, *forceRefresh, nil)
+
+	jsonData, err := json.MarshalIndent(allResults, "", "  ")
+	if err != nil {
+		log.Fatalf("Ошибка маршалинга результатов: %v", err)
+	}
+	fmt.Println(string(jsonData))
+}
+
+// resolveConfig загружает config.json или, если это не удалось,
+// значения по умолчанию, и настраивает зависящие от него подсистемы,
+// не требующие живого браузера (ротация User-Agent).
+func resolveConfig() ConfigSettings {
+	config, err := loadConfig("config.json")
+	if err != nil {
+		log.Printf("Ошибка загрузки config.json: %v. Используются значения по умолчанию.", err)
+		config = getDefaultConfig()
+	}
+	agents.Configure(config.UserAgentRefreshHours)
+	return config
+}
+
+// setupCache открывает кэш позиций, если включён инкрементальный
+// режим, выполняет GC устаревших записей и возвращает nil, если кэш
+// не настроен или не удалось его открыть (в этом случае
+// config.Incremental сбрасывается в false).
+func setupCache(config *ConfigSettings) *cache.Store {
+	if !config.Incremental {
+		return nil
+	}
+
+	cacheStore, err := cache.Open(config.CachePath)
+	if err != nil {
+		log.Printf("Не удалось открыть кэш позиций: %v. Инкрементальный режим отключён.", err)
+		config.Incremental = false
+		return nil
+	}
+
+	if removed, gcErr := cacheStore.GC(30 * 24 * time.Hour); gcErr != nil {
+		log.Printf("Не удалось выполнить GC кэша: %v", gcErr)
+	} else if removed > 0 {
+		log.Printf("GC кэша: удалено %d устаревших записей", removed)
+	}
+
+	return cacheStore
+}
+
+// setupSolver настраивает решатель CAPTCHA согласно config.Solver.
+// Пустой Provider означает, что решатель не используется.
+func setupSolver(config ConfigSettings) solver.Solver {
+	if config.Solver.Provider == "" {
+		return nil
+	}
+
+	slv, err := solver.New(solver.Config{
+		Provider: config.Solver.Provider,
+		APIKey:   config.Solver.APIKey,
+		Timeout:  time.Duration(config.Solver.Timeout) * time.Second,
+	})
+	if err != nil {
+		log.Printf("Не удалось настроить решатель капчи: %v. Решение капч отключено.", err)
+		return nil
+	}
+	return slv
+}
+
+// runner хранит всё, что нужно для разбора InputData: живой браузер,
+// пул прокси и опциональные решатель капчи и кэш позиций. Один runner
+// переживает множество вызовов run — это то, что позволяет серверному
+// режиму держать браузер прогретым между запросами.
+type runner struct {
+	browser    playwright.Browser
+	config     ConfigSettings
+	pool       *proxypool.Pool
+	slv        solver.Solver
+	cacheStore *cache.Store
+}
+
+func newRunner(browser playwright.Browser, config ConfigSettings, slv solver.Solver, cacheStore *cache.Store) *runner {
+	pool := proxypool.New(config.Proxies)
+	if len(config.Proxies) > 0 {
+		log.Printf("Проверяем здоровье %d прокси перед стартом", len(config.Proxies))
+		pool.HealthCheck(func(proxy string) error {
+			return probeProxy(proxy)
+		})
+	}
+
+	return &runner{
+		browser:    browser,
+		config:     config,
+		pool:       pool,
+		slv:        slv,
+		cacheStore: cacheStore,
+	}
+}
+
+// run разбирает все города из inputData и возвращает список
+// результатов. Если emit не nil, он вызывается для каждого результата
+// сразу по готовности — это то, что позволяет серверному режиму
+// стримить результаты как NDJSON, не дожидаясь конца всего запроса.
+func (r *runner) run(ctx context.Context, inputData InputData, forceRefresh bool, emit func(PositionResult)) []PositionResult {
+	ctx, runSpan := tracer.Start(ctx, "parse.run", trace.WithAttributes(
+		attribute.Int("cities.count", len(inputData.Cities)),
+		attribute.String("query", inputData.Query),
+	))
+	defer runSpan.End()
+
+	cities := make([]City, len(inputData.Cities))
+	for i, citySlug := range inputData.Cities {
+		cities[i] = City{Name: citySlug, Slug: citySlug}
+	}
+
+	cacheTTL := time.Duration(r.config.CacheTTLMinutes) * time.Minute
 	resultsChan := make(chan PositionResult, len(cities))
+
+	citiesChan := make(chan City, len(cities))
+	for _, city := range cities {
+		if r.config.Incremental && !forceRefresh && r.cacheStore != nil {
+			if positions, ok, err := r.cacheStore.FreshPositions(city.Slug, inputData.Query, inputData.AdIDs, cacheTTL); err != nil {
+				logger.Warn("не удалось прочитать кэш", "city", city.Name, "error", err)
+			} else if ok {
+				logger.Info("город пропущен: все позиции уже есть в свежем кэше", "city", city.Name)
+				resultsChan <- PositionResult{
+					City:      city.Name,
+					Positions: positions,
+					FromCache: true,
+				}
+				continue
+			}
+		}
+		citiesChan <- city
+	}
+	close(citiesChan)
+
 	var wg sync.WaitGroup
 
-	for proxy, cities := range cityGroups {
+	workers := r.config.MaxWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
-		go func(proxy string, cities []City) {
+		go func(workerID int) {
 			defer wg.Done()
-			processCities(browser, cities, proxy, config, inputData, resultsChan)
-		}(proxy, cities)
+			runWorker(ctx, workerID, r.browser, citiesChan, r.config, inputData, r.slv, r.pool, r.cacheStore, resultsChan)
+		}(i)
 	}
 
 	go func() {
@@ -106,14 +306,13 @@ func main() {
 
 	var allResults []PositionResult
 	for result := range resultsChan {
+		if emit != nil {
+			emit(result)
+		}
 		allResults = append(allResults, result)
 	}
 
-	jsonData, err := json.MarshalIndent(allResults, "", "  ")
-	if err != nil {
-		log.Fatalf("Ошибка маршалинга результатов: %v", err)
-	}
-	fmt.Println(string(jsonData))
+	return allResults
 }
 
 func loadConfig(filename string) (ConfigSettings, error) {
@@ -131,13 +330,16 @@ func loadConfig(filename string) (ConfigSettings, error) {
 
 func getDefaultConfig() ConfigSettings {
 	return ConfigSettings{
-		Timeout:    30,
-		MaxWorkers: 3,
-		MinDelay:   3,
-		MaxDelay:   10,
-		Headless:   true,
-		Proxies:    []string{},
-		MaxRetries: 2,
+		Timeout:               30,
+		MaxWorkers:            3,
+		MinDelay:              3,
+		MaxDelay:              10,
+		Headless:              true,
+		Proxies:               []string{},
+		MaxRetries:            2,
+		UserAgentRefreshHours: 24,
+		CachePath:             "cache.sqlite",
+		CacheTTLMinutes:       60,
 	}
 }
 
@@ -148,43 +350,100 @@ func loadInputData() (InputData, error) {
 	return inputData, err
 }
 
-func distributeCities(cities []City, proxies []string) map[string][]City {
-	groups := make(map[string][]City)
-	groups[""] = []City{}
+// runWorker последовательно забирает города из cities и обрабатывает
+// их, каждый раз запрашивая у pool лучший на данный момент здоровый
+// прокси, а не работая с одним статически закреплённым прокси.
+func runWorker(ctx context.Context, workerID int, browser playwright.Browser, cities <-chan City, config ConfigSettings, inputData InputData, slv solver.Solver, pool *proxypool.Pool, cacheStore *cache.Store, resultsChan chan<- PositionResult) {
+	for city := range cities {
+		cityCtx, citySpan := tracer.Start(ctx, "parse.city", trace.WithAttributes(
+			attribute.String("city.slug", city.Slug),
+		))
 
-	for _, proxy := range proxies {
-		groups[proxy] = []City{}
-	}
+		delay := time.Duration(rand.Intn(config.MaxDelay-config.MinDelay+1)+config.MinDelay) * time.Second
+		logger.Info("ожидание перед запросом", "worker", workerID, "city", city.Name, "delay", delay)
+		time.Sleep(delay)
 
-	for i, city := range cities {
-		if len(proxies) > 0 {
-			proxyIndex := i % len(proxies)
-			proxy := proxies[proxyIndex]
-			groups[proxy] = append(groups[proxy], city)
-		} else {
-			groups[""] = append(groups[""], city)
+		proxy, ok := pool.Best()
+		if !ok {
+			logger.Warn("все прокси в карантине, работаем без прокси", "worker", workerID)
+			proxy = ""
 		}
-	}
 
-	return groups
-}
+		browserCtx, usedProxy, err := newBrowserContext(browser, proxy)
+		citySpan.SetAttributes(attribute.String("proxy", usedProxy))
+		if err != nil {
+			logger.Error("не удалось создать контекст браузера", "proxy", proxy, "error", err)
+			result := PositionResult{
+				City:      city.Name,
+				Positions: make(map[int]string),
+				Error:     fmt.Sprintf("Не удалось создать контекст браузера: %v", err),
+				ProxyUsed: usedProxy,
+				TraceID:   spanTraceID(citySpan),
+			}
+			citySpan.RecordError(err)
+			citySpan.End()
+			resultsChan <- result
+			if proxy != "" {
+				pool.ReportFailure(proxy, false)
+			}
+			continue
+		}
 
-func processCities(browser playwright.Browser, cities []City, proxy string, config ConfigSettings, inputData InputData, resultsChan chan<- PositionResult) {
-	if len(cities) == 0 {
-		return
+		start := time.Now()
+		result := parseCityWithRetry(cityCtx, browserCtx, city, inputData.Query, inputData.AdIDs, config, slv)
+		result.ProxyUsed = usedProxy
+		result.TraceID = spanTraceID(citySpan)
+		browserCtx.Close()
+		serverMetrics.recordCityParsed(result.Blocked, time.Since(start))
+
+		citySpan.SetAttributes(
+			attribute.Bool("blocked", result.Blocked),
+			attribute.Int("ad_ids_found", len(result.Positions)),
+		)
+		citySpan.End()
+
+		if usedProxy != "" {
+			switch {
+			case result.Blocked:
+				pool.ReportFailure(usedProxy, true)
+			case result.Error != "":
+				pool.ReportFailure(usedProxy, false)
+			default:
+				pool.ReportSuccess(usedProxy, time.Since(start))
+			}
+		}
+
+		if config.Incremental && result.Error == "" && cacheStore != nil {
+			now := time.Now()
+			for adID, position := range result.Positions {
+				if err := cacheStore.Put(city.Slug, inputData.Query, adID, position, now); err != nil {
+					logger.Error("не удалось сохранить позицию в кэш", "city", city.Name, "error", err)
+				}
+			}
+		}
+
+		resultsChan <- result
 	}
+}
 
+// newBrowserContext создаёт контекст браузера через proxy (или без
+// прокси, если proxy пустой либо не парсится как URL) и добавляет
+// базовый stealth-скрипт, маскирующий автоматизацию. Возвращает прокси,
+// который реально был использован (может отличаться от запрошенного,
+// если proxy оказался невалидным).
+func newBrowserContext(browser playwright.Browser, proxy string) (playwright.BrowserContext, string, error) {
 	var context playwright.BrowserContext
 	var err error
+	usedProxy := proxy
 
 	if proxy != "" {
 		log.Printf("Создаем контекст с прокси: %s", proxy)
 
-		u, err := url.Parse(proxy)
-		if err != nil {
-			log.Printf("Ошибка парсинга прокси %s: %v. Работаем без прокси.", proxy, err)
+		u, parseErr := url.Parse(proxy)
+		if parseErr != nil {
+			log.Printf("Ошибка парсинга прокси %s: %v. Работаем без прокси.", proxy, parseErr)
+			usedProxy = ""
 			context, err = browser.NewContext()
-			proxy = ""
 		} else {
 			pwProxy := playwright.Proxy{
 				Server: u.Scheme + "://" + u.Host,
@@ -202,91 +461,109 @@ func processCities(browser playwright.Browser, cities []City, proxy string, conf
 				Proxy: &pwProxy,
 			})
 		}
-
 	} else {
 		context, err = browser.NewContext()
 	}
 
 	if err != nil {
-		log.Printf("Не удалось создать контекст браузера: %v", err)
-		for _, city := range cities {
-			resultsChan <- PositionResult{
-				City:      city.Name,
-				Positions: make(map[int]string),
-				Error:     fmt.Sprintf("Не удалось создать контекст браузера: %v", err),
-				ProxyUsed: proxy,
-			}
-		}
-		return
+		return nil, usedProxy, err
 	}
-	defer context.Close()
 
 	initScript := `
 		Object.defineProperty(navigator, 'webdriver', { get: () => undefined });
-		Object.defineProperty(navigator, 'plugins', { get: () => [1, 2, 3, 4, 5] });
-		Object.defineProperty(navigator, 'languages', { get: () => ['ru-RU', 'ru', 'en'] });
 		window.chrome = { runtime: {} };
 	`
-	err = context.AddInitScript(playwright.Script{
-		Content: &initScript,
-	})
+	if scriptErr := context.AddInitScript(playwright.Script{Content: &initScript}); scriptErr != nil {
+		log.Printf("Не удалось добавить init script: %v", scriptErr)
+	}
+
+	return context, usedProxy, nil
+}
+
+// probeProxy выполняет дешёвый запрос через proxy, чтобы отсеять явно
+// мёртвые прокси ещё до начала основного прогона.
+func probeProxy(proxy string) error {
+	u, err := url.Parse(proxy)
 	if err != nil {
-		log.Printf("Не удалось добавить init script: %v", err)
+		return fmt.Errorf("не удалось разобрать адрес прокси: %w", err)
 	}
 
-	for _, city := range cities {
-		delay := time.Duration(rand.Intn(config.MaxDelay-config.MinDelay+1)+config.MinDelay) * time.Second
-		log.Printf("Ожидание %v перед запросом для города %s (прокси: %s)", delay, city.Name, proxy)
-		time.Sleep(delay)
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{Proxy: http.ProxyURL(u)},
+	}
 
-		result := parseCityWithRetry(context, city, inputData.Query, inputData.AdIDs, config)
-		result.ProxyUsed = proxy
-		resultsChan <- result
+	resp, err := client.Get("https://www.avito.ru/")
+	if err != nil {
+		return fmt.Errorf("прокси не отвечает: %w", err)
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("прокси вернул статус %d", resp.StatusCode)
+	}
+
+	return nil
 }
 
-func parseCityWithRetry(context playwright.BrowserContext, city City, query string, adIDs []int, config ConfigSettings) PositionResult {
+func parseCityWithRetry(ctx context.Context, browserCtx playwright.BrowserContext, city City, query string, adIDs []int, config ConfigSettings, slv solver.Solver) PositionResult {
 	var result PositionResult
 
 	for attempt := 0; attempt <= config.MaxRetries; attempt++ {
+		attemptCtx, attemptSpan := tracer.Start(ctx, "parse.attempt", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+		))
+
 		if attempt > 0 {
 			retryDelay := time.Duration(attempt*5) * time.Second
-			log.Printf("Повторная попытка %d для города %s через %v", attempt, city.Name, retryDelay)
+			logger.Info("повторная попытка", "attempt", attempt, "city", city.Name, "delay", retryDelay)
 			time.Sleep(retryDelay)
 		}
 
-		result = parseCity(context, city, query, adIDs, config)
+		result = parseCity(attemptCtx, browserCtx, city, query, adIDs, config, slv)
+		attemptSpan.SetAttributes(attribute.Bool("blocked", result.Blocked))
+		attemptSpan.End()
 
 		if result.Error == "" || (!result.Blocked && !strings.Contains(result.Error, "timeout")) {
 			break
 		}
 
-		log.Printf("Попытка %d для города %s не удалась: %s", attempt, city.Name, result.Error)
+		logger.Warn("попытка не удалась", "attempt", attempt, "city", city.Name, "error", result.Error)
 	}
 
 	return result
 }
 
-func parseCity(context playwright.BrowserContext, city City, query string, adIDs []int, config ConfigSettings) PositionResult {
+func parseCity(ctx context.Context, browserCtx playwright.BrowserContext, city City, query string, adIDs []int, config ConfigSettings, slv solver.Solver) PositionResult {
 	result := PositionResult{
 		City:      city.Name,
 		Positions: make(map[int]string),
 	}
 
-	page, err := context.NewPage()
+	page, err := browserCtx.NewPage()
 	if err != nil {
 		result.Error = fmt.Sprintf("Не удалось создать страницу: %v", err)
 		return result
 	}
 	defer page.Close()
 
-	randomUserAgent := userAgents[rand.Intn(len(userAgents))]
+	userAgent, hints := agents.Pick()
 	err = page.SetExtraHTTPHeaders(map[string]string{
-		"User-Agent":      randomUserAgent,
+		"User-Agent":      userAgent,
 		"Accept-Language": "ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7",
 	})
 	if err != nil {
-		log.Printf("Не удалось установить заголовки: %v", err)
+		logger.Warn("не удалось установить заголовки", "error", err)
+	}
+
+	hintsScript := fmt.Sprintf(`
+		Object.defineProperty(navigator, 'platform', { get: () => %q });
+		Object.defineProperty(navigator, 'languages', { get: () => %s });
+		Object.defineProperty(navigator, 'plugins', { get: () => new Array(%d) });
+	`, hints.Platform, jsStringArray(hints.Languages), hints.Plugins)
+	err = page.AddInitScript(playwright.Script{Content: &hintsScript})
+	if err != nil {
+		logger.Warn("не удалось добавить init script для navigator", "error", err)
 	}
 
 	encodedQuery := strings.ReplaceAll(query, " ", "+")
@@ -297,10 +574,12 @@ func parseCity(context playwright.BrowserContext, city City, query string, adIDs
 		timeout = 15000
 	}
 
+	_, gotoSpan := tracer.Start(ctx, "parse.goto")
 	_, err = page.Goto(avitoURL, playwright.PageGotoOptions{
 		Timeout:   playwright.Float(timeout),
 		WaitUntil: playwright.WaitUntilStateDomcontentloaded,
 	})
+	gotoSpan.End()
 
 	if err != nil {
 		currentURL := page.URL()
@@ -318,21 +597,41 @@ func parseCity(context playwright.BrowserContext, city City, query string, adIDs
 
 	time.Sleep(2 * time.Second)
 
-	// if isBlocked, reason := checkIfBlocked(page); isBlocked {
-	// 	result.Error = fmt.Sprintf("Обнаружена блокировка: %s", reason)
-	// 	result.Blocked = true поху тестим
-	// 	return result
-	// }
+	blockCheckCtx, blockCheckSpan := tracer.Start(ctx, "parse.block_check")
+	isBlocked, reason := checkIfBlocked(page)
+	blockCheckSpan.SetAttributes(attribute.Bool("blocked", isBlocked))
+	blockCheckSpan.End()
+
+	if isBlocked {
+		solveCtx, solveSpan := tracer.Start(blockCheckCtx, "parse.solve_challenge", trace.WithAttributes(
+			attribute.String("reason", reason),
+		))
+		solveTimeout := time.Duration(config.Solver.Timeout) * time.Second
+		solved := slv != nil && trySolveChallenge(solveCtx, slv, page, reason, solveTimeout)
+		solveSpan.SetAttributes(attribute.Bool("solved", solved))
+		solveSpan.End()
+
+		if solved {
+			logger.Info("челлендж решён, продолжаем разбор страницы", "city", city.Name)
+		} else {
+			result.Error = fmt.Sprintf("Обнаружена блокировка: %s", reason)
+			result.Blocked = true
+			return result
+		}
+	}
 
+	_, waitSpan := tracer.Start(ctx, "parse.wait_for_selector")
 	_, err = page.WaitForSelector("[data-item-id]", playwright.PageWaitForSelectorOptions{
 		Timeout: playwright.Float(10000),
 	})
+	waitSpan.End()
 
 	if err != nil {
 		result.Error = "Не удалось дождаться появления объявлений"
 		return result
 	}
 
+	_, scrollSpan := tracer.Start(ctx, "parse.scroll")
 	for i := 0; i < 3; i++ {
 		scrollResult, err := page.Evaluate(`() => {
 			if (document.body && document.body.scrollHeight) {
@@ -343,16 +642,17 @@ func parseCity(context playwright.BrowserContext, city City, query string, adIDs
 		}`)
 
 		if err != nil {
-			log.Printf("Ошибка при скролле: %v", err)
+			logger.Warn("ошибка при скролле", "error", err)
 		} else if scrollResult != nil {
 			if scrollMap, ok := scrollResult.(map[string]interface{}); ok {
 				if success, ok := scrollMap["success"].(bool); ok && success {
-					log.Printf("Успешно прокрутили на %vpx", scrollMap["height"])
+					logger.Info("успешно прокрутили страницу", "height", scrollMap["height"])
 				}
 			}
 		}
 		time.Sleep(1 * time.Second)
 	}
+	scrollSpan.End()
 
 	items, err := page.QuerySelectorAll("[data-item-id]")
 	if err != nil {
@@ -396,6 +696,16 @@ func parseCity(context playwright.BrowserContext, city City, query string, adIDs
 	return result
 }
 
+// jsStringArray сериализует слайс строк в литерал JS-массива для
+// подстановки в init script.
+func jsStringArray(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
 func checkIfBlocked(page playwright.Page) (bool, string) {
 	title, err := page.Title()
 	if err == nil {
@@ -457,3 +767,128 @@ func checkIfBlocked(page playwright.Page) (bool, string) {
 
 	return false, ""
 }
+
+// defaultSolveTimeout используется, если SolverConfig.Timeout не задан
+// (тот же дефолт, что и solver.New для внутреннего цикла опроса).
+const defaultSolveTimeout = 2 * time.Minute
+
+// trySolveChallenge пытается распознать и решить челлендж, из-за
+// которого checkIfBlocked сообщил о блокировке reason, через slv, и
+// подставить полученный токен на странице. timeout ограничивает,
+// сколько ждать решения — настраивается через SolverConfig.Timeout, а
+// не зашит литералом, чтобы отражать то же значение, которым уже
+// ограничен внутренний цикл опроса в solver.New. Возвращает true, если
+// челлендж удалось решить и отправить.
+func trySolveChallenge(ctx context.Context, slv solver.Solver, page playwright.Page, reason string, timeout time.Duration) bool {
+	challenge, responseField, err := detectChallenge(page, reason)
+	if err != nil {
+		logger.Warn("не удалось распознать челлендж для решения", "error", err)
+		return false
+	}
+
+	if timeout <= 0 {
+		timeout = defaultSolveTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	serverMetrics.recordSolverCall()
+	solution, err := slv.Solve(ctx, challenge)
+	if err != nil {
+		logger.Warn("не удалось решить челлендж", "type", challenge.Type, "error", err)
+		return false
+	}
+
+	script := fmt.Sprintf(`(token) => {
+		const field = document.getElementById(%q) || document.getElementsByName(%q)[0];
+		if (field) {
+			field.innerHTML = token;
+			field.value = token;
+			const form = field.closest('form');
+			if (form) {
+				form.submit();
+			}
+		}
+	}`, responseField, responseField)
+
+	if _, err := page.Evaluate(script, solution.Token); err != nil {
+		logger.Warn("не удалось подставить токен решения в страницу", "error", err)
+		return false
+	}
+
+	return true
+}
+
+// detectChallenge определяет тип челленджа по reason от checkIfBlocked
+// и достаёт его sitekey со страницы.
+func detectChallenge(page playwright.Page, reason string) (solver.Challenge, string, error) {
+	lower := strings.ToLower(reason)
+
+	var challengeType solver.ChallengeType
+	var responseField string
+	var selector string
+
+	switch {
+	case strings.Contains(lower, "recaptcha"):
+		challengeType = solver.ChallengeRecaptchaV2
+		responseField = "g-recaptcha-response"
+		selector = "[data-sitekey], iframe[src*='recaptcha']"
+	case strings.Contains(lower, "hcaptcha"):
+		challengeType = solver.ChallengeHCaptcha
+		responseField = "h-captcha-response"
+		selector = "[data-sitekey], iframe[src*='hcaptcha']"
+	case strings.Contains(lower, "turnstile") || strings.Contains(lower, "cloudflare"):
+		challengeType = solver.ChallengeTurnstile
+		responseField = "cf-turnstile-response"
+		selector = "[data-sitekey], iframe[src*='turnstile']"
+	default:
+		return solver.Challenge{}, "", fmt.Errorf("блокировка %q не является поддерживаемым челленджем", reason)
+	}
+
+	siteKey, err := extractSiteKey(page, selector)
+	if err != nil {
+		return solver.Challenge{}, "", err
+	}
+
+	return solver.Challenge{
+		Type:    challengeType,
+		SiteKey: siteKey,
+		PageURL: page.URL(),
+	}, responseField, nil
+}
+
+// extractSiteKey достаёт sitekey из атрибута data-sitekey, либо из
+// query-параметра k/sitekey в src соответствующего iframe.
+func extractSiteKey(page playwright.Page, selector string) (string, error) {
+	el, err := page.QuerySelector("[data-sitekey]")
+	if err == nil && el != nil {
+		if key, err := el.GetAttribute("data-sitekey"); err == nil && key != "" {
+			return key, nil
+		}
+	}
+
+	iframes, err := page.QuerySelectorAll(selector)
+	if err != nil {
+		return "", fmt.Errorf("не удалось найти iframe челленджа: %w", err)
+	}
+
+	for _, iframe := range iframes {
+		src, err := iframe.GetAttribute("src")
+		if err != nil || src == "" {
+			continue
+		}
+		u, err := url.Parse(src)
+		if err != nil {
+			continue
+		}
+		if key := u.Query().Get("k"); key != "" {
+			return key, nil
+		}
+		if key := u.Query().Get("sitekey"); key != "" {
+			return key, nil
+		}
+	}
+
+	return "", fmt.Errorf("не удалось найти sitekey на странице")
+}
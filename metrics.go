@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// durationBucketsSeconds — границы бакетов гистограммы длительности
+// разбора одного города, в секундах.
+var durationBucketsSeconds = []float64{1, 2, 5, 10, 20, 30, 60}
+
+// metrics собирает счётчики и гистограмму для эндпоинта /metrics в
+// серверном режиме. Создаётся через newMetrics: у нулевого значения нет
+// бакетов гистограммы.
+type metrics struct {
+	parsedCities int64
+	blockedCount int64
+	solverCalls  int64
+
+	mu           sync.Mutex
+	bucketCounts []int64
+	sum          float64
+	count        int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{bucketCounts: make([]int64, len(durationBucketsSeconds))}
+}
+
+// serverMetrics — общий счётчик метрик пайплайна разбора. Обновляется
+// в обоих режимах (разовый запуск и сервер), но эндпоинт /metrics
+// существует только в серверном режиме.
+var serverMetrics = newMetrics()
+
+func (m *metrics) recordCityParsed(blocked bool, duration time.Duration) {
+	atomic.AddInt64(&m.parsedCities, 1)
+	if blocked {
+		atomic.AddInt64(&m.blockedCount, 1)
+	}
+
+	seconds := duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sum += seconds
+	m.count++
+	for i, le := range durationBucketsSeconds {
+		if seconds <= le {
+			m.bucketCounts[i]++
+		}
+	}
+}
+
+func (m *metrics) recordSolverCall() {
+	atomic.AddInt64(&m.solverCalls, 1)
+}
+
+// render форматирует накопленные метрики в формате Prometheus text
+// exposition.
+func (m *metrics) render() string {
+	m.mu.Lock()
+	bucketCounts := append([]int64(nil), m.bucketCounts...)
+	sum := m.sum
+	count := m.count
+	m.mu.Unlock()
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# HELP avito_parser_cities_parsed_total Количество разобранных городов.\n")
+	fmt.Fprintf(&b, "# TYPE avito_parser_cities_parsed_total counter\n")
+	fmt.Fprintf(&b, "avito_parser_cities_parsed_total %d\n", atomic.LoadInt64(&m.parsedCities))
+
+	fmt.Fprintf(&b, "# HELP avito_parser_blocks_total Количество обнаруженных блокировок.\n")
+	fmt.Fprintf(&b, "# TYPE avito_parser_blocks_total counter\n")
+	fmt.Fprintf(&b, "avito_parser_blocks_total %d\n", atomic.LoadInt64(&m.blockedCount))
+
+	fmt.Fprintf(&b, "# HELP avito_parser_solver_calls_total Количество обращений к решателю капчи.\n")
+	fmt.Fprintf(&b, "# TYPE avito_parser_solver_calls_total counter\n")
+	fmt.Fprintf(&b, "avito_parser_solver_calls_total %d\n", atomic.LoadInt64(&m.solverCalls))
+
+	fmt.Fprintf(&b, "# HELP avito_parser_city_duration_seconds Длительность разбора одного города.\n")
+	fmt.Fprintf(&b, "# TYPE avito_parser_city_duration_seconds histogram\n")
+	// bucketCounts уже кумулятивны (recordCityParsed увеличивает каждый
+	// бакет, чей le удовлетворён наблюдением) — здесь их нужно только
+	// напечатать, без повторного накопления.
+	for i, le := range durationBucketsSeconds {
+		fmt.Fprintf(&b, "avito_parser_city_duration_seconds_bucket{le=\"%g\"} %d\n", le, bucketCounts[i])
+	}
+	fmt.Fprintf(&b, "avito_parser_city_duration_seconds_bucket{le=\"+Inf\"} %d\n", count)
+	fmt.Fprintf(&b, "avito_parser_city_duration_seconds_sum %g\n", sum)
+	fmt.Fprintf(&b, "avito_parser_city_duration_seconds_count %d\n", count)
+
+	return b.String()
+}
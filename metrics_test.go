@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRenderDoesNotReaccumulateBuckets воспроизводит баг, исправленный в
+// 9d57c54: bucketCounts уже кумулятивны к моменту вызова render(),
+// поэтому повторный вызов render() не должен увеличивать счётчики ещё
+// раз — render() только форматирует уже накопленное состояние.
+func TestRenderDoesNotReaccumulateBuckets(t *testing.T) {
+	m := newMetrics()
+	m.recordCityParsed(false, 3*time.Second)
+
+	first := m.render()
+	second := m.render()
+
+	if first != second {
+		t.Fatalf("render() must be idempotent, got:\n%s\n---\n%s", first, second)
+	}
+
+	wantLine := `avito_parser_city_duration_seconds_bucket{le="5"} 1`
+	if !strings.Contains(second, wantLine) {
+		t.Fatalf("expected bucket le=5 to stay at 1 after a second render(), got:\n%s", second)
+	}
+}
+
+func TestRecordCityParsedFillsOnlyMatchingBuckets(t *testing.T) {
+	m := newMetrics()
+	m.recordCityParsed(false, 7*time.Second)
+
+	out := m.render()
+
+	for _, tc := range []struct {
+		le    string
+		count int
+	}{
+		{"1", 0},
+		{"2", 0},
+		{"5", 0},
+		{"10", 1},
+		{"20", 1},
+		{"30", 1},
+		{"60", 1},
+	} {
+		want := `avito_parser_city_duration_seconds_bucket{le="` + tc.le + `"} ` + strconv.Itoa(tc.count)
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestRecordCityParsedUpdatesCountersAndSum(t *testing.T) {
+	m := newMetrics()
+	m.recordCityParsed(true, 2*time.Second)
+	m.recordCityParsed(false, 4*time.Second)
+
+	out := m.render()
+
+	if !strings.Contains(out, "avito_parser_cities_parsed_total 2") {
+		t.Fatalf("expected cities_parsed_total=2, got:\n%s", out)
+	}
+	if !strings.Contains(out, "avito_parser_blocks_total 1") {
+		t.Fatalf("expected blocks_total=1, got:\n%s", out)
+	}
+	if !strings.Contains(out, "avito_parser_city_duration_seconds_sum 6") {
+		t.Fatalf("expected duration sum=6, got:\n%s", out)
+	}
+	if !strings.Contains(out, "avito_parser_city_duration_seconds_count 2") {
+		t.Fatalf("expected duration count=2, got:\n%s", out)
+	}
+}
@@ -0,0 +1,245 @@
+// Package proxypool отслеживает здоровье прокси (успехи, блокировки,
+// задержку) и подбирает для очередного запроса "лучший" живой прокси
+// вместо простого round-robin по статическому списку.
+//
+// Прокси, у которых подряд накопилось слишком много неудач, уходят в
+// карантин на время остывания с экспоненциальным ростом, а выбор среди
+// оставшихся здоровых прокси взвешен по success-rate / latency.
+package proxypool
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// maxConsecutiveFailures — после скольких подряд неудач прокси
+	// уходит в карантин.
+	maxConsecutiveFailures = 3
+	// baseQuarantine — длительность первого карантина, дальше растёт
+	// экспоненциально с каждым новым провалом подряд.
+	baseQuarantine = 2 * time.Minute
+	// maxQuarantineShift ограничивает показатель степени для
+	// экспоненциального роста карантина: без этого предела у
+	// долго живущего демона (chunk0-5) мёртвый прокси рано или поздно
+	// копит 30 неудач подряд, сдвиг на 27 переполняет time.Duration,
+	// backoff становится отрицательным и карантин схлопывается.
+	// 6 даёт потолок в baseQuarantine*64.
+	maxQuarantineShift = 6
+)
+
+type stats struct {
+	successCount        int
+	blockCount          int
+	consecutiveFailures int
+	lastUsed            time.Time
+	avgLatency          time.Duration
+	quarantinedUntil    time.Time
+}
+
+// Pool хранит статистику по набору прокси и потокобезопасно выбирает
+// среди них "лучший" для следующего запроса. Пустая строка означает
+// "без прокси" и ведёт себя как обычный участник пула.
+type Pool struct {
+	mu    sync.Mutex
+	stats map[string]*stats
+}
+
+// New создаёт пул с указанным набором прокси. Если proxies пуст, пул
+// всегда отдаёт пустую строку (запрос без прокси).
+func New(proxies []string) *Pool {
+	p := &Pool{stats: make(map[string]*stats)}
+	if len(proxies) == 0 {
+		p.stats[""] = &stats{}
+		return p
+	}
+	for _, proxy := range proxies {
+		p.stats[proxy] = &stats{}
+	}
+	return p
+}
+
+// Best возвращает прокси, выбранный взвешенным случайным выбором среди
+// здоровых (не в карантине) прокси по success-rate / latency. Второе
+// значение равно false, если все прокси сейчас в карантине.
+func (p *Pool) Best() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	type candidate struct {
+		proxy  string
+		weight float64
+	}
+	var candidates []candidate
+	var total float64
+
+	for proxy, s := range p.stats {
+		if now.Before(s.quarantinedUntil) {
+			continue
+		}
+		weight := scoreOf(s)
+		candidates = append(candidates, candidate{proxy: proxy, weight: weight})
+		total += weight
+	}
+
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	r := rand.Float64() * total
+	var cum float64
+	for _, c := range candidates {
+		cum += c.weight
+		if r <= cum {
+			return c.proxy, true
+		}
+	}
+	return candidates[len(candidates)-1].proxy, true
+}
+
+func scoreOf(s *stats) float64 {
+	total := s.successCount + s.blockCount
+	successRate := 1.0
+	if total > 0 {
+		successRate = float64(s.successCount) / float64(total)
+	}
+
+	latency := s.avgLatency
+	if latency <= 0 {
+		latency = 500 * time.Millisecond
+	}
+
+	score := successRate / latency.Seconds()
+	if score <= 0 {
+		return 0.01
+	}
+	return score
+}
+
+// ReportSuccess отмечает успешный запрос через proxy и обновляет
+// скользящую среднюю задержки.
+func (p *Pool) ReportSuccess(proxy string, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.entry(proxy)
+	s.successCount++
+	s.consecutiveFailures = 0
+	s.lastUsed = time.Now()
+	s.quarantinedUntil = time.Time{}
+
+	if s.avgLatency == 0 {
+		s.avgLatency = latency
+	} else {
+		s.avgLatency = (s.avgLatency*4 + latency) / 5
+	}
+}
+
+// ReportFailure отмечает неудачный запрос через proxy. blocked
+// означает, что причиной был бан/антибот, а не случайная ошибка сети.
+// После maxConsecutiveFailures подряд неудач прокси уходит в карантин
+// с экспоненциально растущим временем остывания.
+func (p *Pool) ReportFailure(proxy string, blocked bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.entry(proxy)
+	if blocked {
+		s.blockCount++
+	}
+	s.consecutiveFailures++
+	s.lastUsed = time.Now()
+
+	if s.consecutiveFailures >= maxConsecutiveFailures {
+		shift := s.consecutiveFailures - maxConsecutiveFailures
+		if shift > maxQuarantineShift {
+			shift = maxQuarantineShift
+		}
+		backoff := baseQuarantine << shift
+		s.quarantinedUntil = time.Now().Add(backoff)
+	}
+}
+
+// Quarantine немедленно отправляет proxy в карантин на baseQuarantine,
+// минуя счётчик подряд идущих неудач. Используется стартовой
+// проверкой здоровья для явно мёртвых прокси.
+func (p *Pool) Quarantine(proxy string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.entry(proxy)
+	s.consecutiveFailures = maxConsecutiveFailures
+	s.quarantinedUntil = time.Now().Add(baseQuarantine)
+}
+
+func (p *Pool) entry(proxy string) *stats {
+	s, ok := p.stats[proxy]
+	if !ok {
+		s = &stats{}
+		p.stats[proxy] = s
+	}
+	return s
+}
+
+// Snapshot — статистика по одному прокси для отображения/отладки.
+type Snapshot struct {
+	Proxy               string    `json:"proxy"`
+	SuccessCount        int       `json:"success_count"`
+	BlockCount          int       `json:"block_count"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	AvgLatencyMs        int64     `json:"avg_latency_ms"`
+	Quarantined         bool      `json:"quarantined"`
+	LastUsed            time.Time `json:"last_used"`
+}
+
+// Snapshots возвращает срез состояния всех прокси в пуле, отсортированный
+// не гарантируется — вызывающий код сортирует при необходимости.
+func (p *Pool) Snapshots() []Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	out := make([]Snapshot, 0, len(p.stats))
+	for proxy, s := range p.stats {
+		out = append(out, Snapshot{
+			Proxy:               proxy,
+			SuccessCount:        s.successCount,
+			BlockCount:          s.blockCount,
+			ConsecutiveFailures: s.consecutiveFailures,
+			AvgLatencyMs:        s.avgLatency.Milliseconds(),
+			Quarantined:         now.Before(s.quarantinedUntil),
+			LastUsed:            s.lastUsed,
+		})
+	}
+	return out
+}
+
+// HealthCheck запускает check для каждого известного прокси и сразу
+// отправляет в карантин те, для которых check вернул ошибку. Полезно
+// перед стартом основного прогона, чтобы явно мёртвые прокси не
+// забирали себе города из первой волны заданий.
+func (p *Pool) HealthCheck(check func(proxy string) error) {
+	p.mu.Lock()
+	proxies := make([]string, 0, len(p.stats))
+	for proxy := range p.stats {
+		proxies = append(proxies, proxy)
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, proxy := range proxies {
+		if proxy == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(proxy string) {
+			defer wg.Done()
+			if err := check(proxy); err != nil {
+				p.Quarantine(proxy)
+			}
+		}(proxy)
+	}
+	wg.Wait()
+}
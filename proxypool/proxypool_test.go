@@ -0,0 +1,58 @@
+package proxypool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScoreOfPrefersHigherSuccessRateAndLowerLatency(t *testing.T) {
+	good := &stats{successCount: 9, blockCount: 1, avgLatency: 200 * time.Millisecond}
+	bad := &stats{successCount: 1, blockCount: 9, avgLatency: 2 * time.Second}
+
+	if scoreOf(good) <= scoreOf(bad) {
+		t.Fatalf("scoreOf(good)=%v should be greater than scoreOf(bad)=%v", scoreOf(good), scoreOf(bad))
+	}
+}
+
+func TestScoreOfNeverZero(t *testing.T) {
+	s := &stats{successCount: 0, blockCount: 100, avgLatency: time.Millisecond}
+	if scoreOf(s) <= 0 {
+		t.Fatalf("scoreOf must stay positive so a consistently failing proxy can still be selected as a last resort, got %v", scoreOf(s))
+	}
+}
+
+// TestReportFailureQuarantineCapsShift воспроизводит баг из ревью: после
+// 30 неудач подряд сдвиг переполняет time.Duration, карантин уходит в
+// прошлое — прокси, умиравший днями, внезапно перестаёт быть в
+// карантине.
+func TestReportFailureQuarantineCapsShift(t *testing.T) {
+	p := New([]string{"proxy-a"})
+
+	for i := 0; i < 200; i++ {
+		p.ReportFailure("proxy-a", true)
+	}
+
+	p.mu.Lock()
+	until := p.stats["proxy-a"].quarantinedUntil
+	p.mu.Unlock()
+
+	minExpected := time.Now().Add(baseQuarantine << maxQuarantineShift).Add(-time.Minute)
+	if until.Before(minExpected) {
+		t.Fatalf("after 200 consecutive failures, quarantinedUntil = %v, want at least capped backoff (%v)", until, minExpected)
+	}
+}
+
+func TestQuarantinedProxyExcludedFromBest(t *testing.T) {
+	p := New([]string{"proxy-a", "proxy-b"})
+	p.Quarantine("proxy-a")
+
+	for i := 0; i < 20; i++ {
+		proxy, ok := p.Best()
+		if !ok {
+			t.Fatalf("expected a healthy proxy to be available")
+		}
+		if proxy == "proxy-a" {
+			t.Fatalf("Best() returned quarantined proxy-a")
+		}
+	}
+}
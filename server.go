@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+
+	"avito-parser/tracing"
+)
+
+// apiServer держит живой браузер прогретым между HTTP-запросами и
+// ограничивает, сколько запросов может разбираться одновременно —
+// как всего, так и от одного клиента.
+type apiServer struct {
+	r *runner
+
+	globalSem    chan struct{}
+	queueTimeout time.Duration
+	maxPerClient int64
+
+	perClientMu    sync.Mutex
+	perClientCount map[string]int64 // client IP -> текущее число активных запросов
+}
+
+func newAPIServer(r *runner, maxConcurrency, maxPerClient int, queueTimeout time.Duration) *apiServer {
+	if maxConcurrency <= 0 {
+		maxConcurrency = 1
+	}
+	if maxPerClient <= 0 {
+		maxPerClient = maxConcurrency
+	}
+
+	return &apiServer{
+		r:              r,
+		globalSem:      make(chan struct{}, maxConcurrency),
+		queueTimeout:   queueTimeout,
+		maxPerClient:   int64(maxPerClient),
+		perClientCount: make(map[string]int64),
+	}
+}
+
+// runServerCommand запускает HTTP-сервер, который держит Playwright и
+// браузер прогретыми между запросами вместо того, чтобы запускать их
+// заново на каждый вызов.
+func runServerCommand(args []string) {
+	fs := flag.NewFlagSet("avito-parser server", flag.ExitOnError)
+	listenAddr := fs.String("listen", ":8080", "адрес, на котором слушает HTTP-сервер")
+	maxConcurrency := fs.Int("max-concurrency", 0, "максимум одновременно выполняемых запросов /parse (0 = MaxWorkers из конфига)")
+	maxPerClient := fs.Int("max-per-client", 2, "максимум одновременных запросов /parse от одного клиента")
+	queueTimeout := fs.Duration("queue-timeout", 30*time.Second, "сколько запрос может ждать свободного слота, прежде чем получить 503")
+	fs.Parse(args)
+
+	config := resolveConfig()
+
+	shutdownTracing, err := tracing.Init(config.OTLPEndpoint)
+	if err != nil {
+		log.Fatalf("Не удалось настроить трейсинг: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	cacheStore := setupCache(&config)
+	if cacheStore != nil {
+		defer cacheStore.Close()
+	}
+	slv := setupSolver(config)
+
+	pw, err := playwright.Run()
+	if err != nil {
+		log.Fatalf("Не удалось запустить Playwright: %v", err)
+	}
+	defer pw.Stop()
+
+	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
+		Headless: playwright.Bool(config.Headless),
+	})
+	if err != nil {
+		log.Fatalf("Не удалось запустить браузер: %v", err)
+	}
+	defer browser.Close()
+
+	r := newRunner(browser, config, slv, cacheStore)
+
+	concurrency := *maxConcurrency
+	if concurrency <= 0 {
+		concurrency = config.MaxWorkers
+	}
+	srv := newAPIServer(r, concurrency, *maxPerClient, *queueTimeout)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", srv.handleHealthz)
+	mux.HandleFunc("/metrics", srv.handleMetrics)
+	mux.HandleFunc("/proxies", srv.handleProxies)
+	mux.HandleFunc("/parse", srv.handleParse)
+
+	httpServer := &http.Server{Addr: *listenAddr, Handler: mux}
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Сервер запущен на %s (max-concurrency=%d, max-per-client=%d)", *listenAddr, concurrency, *maxPerClient)
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	// Слушаем SIGTERM/SIGINT (docker stop, k8s rolling restart), чтобы
+	// корректно остановить HTTP-сервер и дать отработать всем defer'ам
+	// выше (shutdownTracing — дотянуть буфер OTLP-спанов, закрытие кэша
+	// и браузера), а не терять их через os.Exit из log.Fatalf.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-serveErr:
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("HTTP-сервер завершился с ошибкой: %v", err)
+		}
+	case <-ctx.Done():
+		stop()
+		log.Printf("Получен сигнал остановки, завершаем работу...")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Не удалось корректно остановить HTTP-сервер: %v", err)
+		}
+	}
+}
+
+func (s *apiServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+func (s *apiServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(serverMetrics.render()))
+}
+
+func (s *apiServer) handleProxies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.r.pool.Snapshots())
+}
+
+func (s *apiServer) handleParse(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "метод не поддерживается, используйте POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientID := clientIP(r)
+	if !s.acquirePerClient(clientID) {
+		http.Error(w, "слишком много одновременных запросов от этого клиента", http.StatusTooManyRequests)
+		return
+	}
+	defer s.releasePerClient(clientID)
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.queueTimeout)
+	defer cancel()
+
+	select {
+	case s.globalSem <- struct{}{}:
+		defer func() { <-s.globalSem }()
+	case <-ctx.Done():
+		http.Error(w, "очередь переполнена, попробуйте позже", http.StatusServiceUnavailable)
+		return
+	}
+
+	var inputData InputData
+	if err := json.NewDecoder(r.Body).Decode(&inputData); err != nil {
+		http.Error(w, fmt.Sprintf("некорректный JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		s.streamParse(r.Context(), w, inputData)
+		return
+	}
+
+	results := s.r.run(r.Context(), inputData, false, nil)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// streamParse отдаёт результаты по мере готовности в формате NDJSON —
+// по одному городу за раз, а не одним JSON-массивом в конце.
+func (s *apiServer) streamParse(ctx context.Context, w http.ResponseWriter, inputData InputData) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	flusher, canFlush := w.(http.Flusher)
+
+	s.r.run(ctx, inputData, false, func(result PositionResult) {
+		if err := enc.Encode(result); err != nil {
+			log.Printf("Не удалось записать NDJSON-результат: %v", err)
+			return
+		}
+		bw.Flush()
+		if canFlush {
+			flusher.Flush()
+		}
+	})
+}
+
+func (s *apiServer) acquirePerClient(clientID string) bool {
+	s.perClientMu.Lock()
+	defer s.perClientMu.Unlock()
+
+	if s.perClientCount[clientID] >= s.maxPerClient {
+		return false
+	}
+	s.perClientCount[clientID]++
+	return true
+}
+
+// releasePerClient уменьшает счётчик клиента и убирает его из карты,
+// если активных запросов от него больше не осталось — иначе карта
+// растёт без ограничения на весь срок жизни долгоживущего сервера,
+// накапливая запись на каждый когда-либо виденный IP.
+func (s *apiServer) releasePerClient(clientID string) {
+	s.perClientMu.Lock()
+	defer s.perClientMu.Unlock()
+
+	s.perClientCount[clientID]--
+	if s.perClientCount[clientID] <= 0 {
+		delete(s.perClientCount, clientID)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
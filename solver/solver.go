@@ -0,0 +1,225 @@
+// Package solver предоставляет единый интерфейс для решения
+// CAPTCHA/anti-bot челленджей (reCAPTCHA v2, hCaptcha, Cloudflare
+// Turnstile) через внешние сервисы вроде 2Captcha и CapMonster.
+//
+// Оба сервиса совместимы с одним и тем же HTTP-протоколом опроса:
+// задача отправляется в in.php, а результат забирается поллингом
+// res.php по идентификатору задачи, поэтому они реализованы поверх
+// общего pollingSolver.
+package solver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ChallengeType перечисляет типы челленджей, которые умеет решать пакет.
+type ChallengeType string
+
+const (
+	ChallengeRecaptchaV2 ChallengeType = "recaptcha_v2"
+	ChallengeHCaptcha    ChallengeType = "hcaptcha"
+	ChallengeTurnstile   ChallengeType = "turnstile"
+)
+
+// Challenge описывает конкретный челлендж, который нужно решить.
+type Challenge struct {
+	Type    ChallengeType
+	SiteKey string
+	PageURL string
+}
+
+// Solution — токен, который нужно подставить в скрытое поле формы
+// (g-recaptcha-response / h-captcha-response / cf-turnstile-response).
+type Solution struct {
+	Token string
+}
+
+// Solver решает один челлендж и возвращает токен ответа.
+type Solver interface {
+	Solve(ctx context.Context, challenge Challenge) (Solution, error)
+}
+
+// Config настраивает, какой провайдер использовать.
+type Config struct {
+	Provider string        `json:"provider"`
+	APIKey   string        `json:"api_key"`
+	Timeout  time.Duration `json:"timeout"`
+}
+
+// New создаёт Solver для провайдера, указанного в cfg.Provider
+// ("2captcha" или "capmonster"). Пустой Provider означает, что решатель
+// не настроен.
+func New(cfg Config) (Solver, error) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+
+	switch strings.ToLower(cfg.Provider) {
+	case "2captcha":
+		return &pollingSolver{
+			name:       "2captcha",
+			baseURL:    "https://2captcha.com",
+			apiKey:     cfg.APIKey,
+			timeout:    timeout,
+			httpClient: &http.Client{Timeout: 30 * time.Second},
+		}, nil
+	case "capmonster":
+		return &pollingSolver{
+			name:       "capmonster",
+			baseURL:    "https://api.capmonster.cloud",
+			apiKey:     cfg.APIKey,
+			timeout:    timeout,
+			httpClient: &http.Client{Timeout: 30 * time.Second},
+		}, nil
+	case "":
+		return nil, fmt.Errorf("провайдер решателя капчи не настроен")
+	default:
+		return nil, fmt.Errorf("неизвестный провайдер решателя капчи: %s", cfg.Provider)
+	}
+}
+
+// pollingSolver реализует протокол in.php (отправка задачи) / res.php
+// (поллинг результата по идентификатору), общий для 2Captcha и
+// CapMonster.
+type pollingSolver struct {
+	name       string
+	baseURL    string
+	apiKey     string
+	timeout    time.Duration
+	httpClient *http.Client
+}
+
+func (s *pollingSolver) Solve(ctx context.Context, challenge Challenge) (Solution, error) {
+	method, err := methodFor(challenge.Type)
+	if err != nil {
+		return Solution{}, err
+	}
+
+	taskID, err := s.submit(ctx, method, challenge)
+	if err != nil {
+		return Solution{}, fmt.Errorf("%s: не удалось отправить задачу: %w", s.name, err)
+	}
+
+	deadline := time.Now().Add(s.timeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return Solution{}, ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+
+		token, ready, err := s.poll(ctx, taskID)
+		if err != nil {
+			return Solution{}, fmt.Errorf("%s: ошибка опроса результата: %w", s.name, err)
+		}
+		if ready {
+			return Solution{Token: token}, nil
+		}
+	}
+
+	return Solution{}, fmt.Errorf("%s: истёк таймаут ожидания решения капчи", s.name)
+}
+
+func methodFor(t ChallengeType) (string, error) {
+	switch t {
+	case ChallengeRecaptchaV2:
+		return "userrecaptcha", nil
+	case ChallengeHCaptcha:
+		return "hcaptcha", nil
+	case ChallengeTurnstile:
+		return "turnstile", nil
+	default:
+		return "", fmt.Errorf("неподдерживаемый тип челленджа: %s", t)
+	}
+}
+
+func (s *pollingSolver) submit(ctx context.Context, method string, challenge Challenge) (string, error) {
+	form := url.Values{
+		"key":     {s.apiKey},
+		"method":  {method},
+		"sitekey": {challenge.SiteKey},
+		"pageurl": {challenge.PageURL},
+		"json":    {"1"},
+	}
+
+	body, err := s.post(ctx, "/in.php", form)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := parsePollingResponse(body)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Request, nil
+}
+
+func (s *pollingSolver) poll(ctx context.Context, taskID string) (token string, ready bool, err error) {
+	form := url.Values{
+		"key":    {s.apiKey},
+		"action": {"get"},
+		"id":     {taskID},
+		"json":   {"1"},
+	}
+
+	body, err := s.post(ctx, "/res.php", form)
+	if err != nil {
+		return "", false, err
+	}
+
+	resp, err := parsePollingResponse(body)
+	if err != nil {
+		if resp.Request == "CAPCHA_NOT_READY" {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	if resp.Request == "CAPCHA_NOT_READY" {
+		return "", false, nil
+	}
+
+	return resp.Request, true, nil
+}
+
+func (s *pollingSolver) post(ctx context.Context, path string, form url.Values) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+// pollingResponse — общий формат ответа in.php/res.php при json=1.
+type pollingResponse struct {
+	Status  int    `json:"status"`
+	Request string `json:"request"`
+}
+
+func parsePollingResponse(body []byte) (pollingResponse, error) {
+	var resp pollingResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return resp, fmt.Errorf("не удалось разобрать ответ: %w", err)
+	}
+	if resp.Status != 1 && resp.Request != "CAPCHA_NOT_READY" {
+		return resp, fmt.Errorf("сервис вернул ошибку: %s", resp.Request)
+	}
+	return resp, nil
+}
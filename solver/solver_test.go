@@ -0,0 +1,156 @@
+package solver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMethodForKnownTypes(t *testing.T) {
+	cases := map[ChallengeType]string{
+		ChallengeRecaptchaV2: "userrecaptcha",
+		ChallengeHCaptcha:    "hcaptcha",
+		ChallengeTurnstile:   "turnstile",
+	}
+	for challenge, want := range cases {
+		got, err := methodFor(challenge)
+		if err != nil {
+			t.Fatalf("methodFor(%s): %v", challenge, err)
+		}
+		if got != want {
+			t.Fatalf("methodFor(%s) = %q, want %q", challenge, got, want)
+		}
+	}
+}
+
+func TestMethodForUnsupportedType(t *testing.T) {
+	if _, err := methodFor(ChallengeType("unknown")); err == nil {
+		t.Fatalf("expected error for unsupported challenge type")
+	}
+}
+
+func TestParsePollingResponseSuccess(t *testing.T) {
+	resp, err := parsePollingResponse([]byte(`{"status":1,"request":"TOKEN123"}`))
+	if err != nil {
+		t.Fatalf("parsePollingResponse: %v", err)
+	}
+	if resp.Request != "TOKEN123" {
+		t.Fatalf("request = %q, want TOKEN123", resp.Request)
+	}
+}
+
+func TestParsePollingResponseNotReady(t *testing.T) {
+	resp, err := parsePollingResponse([]byte(`{"status":0,"request":"CAPCHA_NOT_READY"}`))
+	if err != nil {
+		t.Fatalf("parsePollingResponse: %v", err)
+	}
+	if resp.Request != "CAPCHA_NOT_READY" {
+		t.Fatalf("request = %q, want CAPCHA_NOT_READY", resp.Request)
+	}
+}
+
+func TestParsePollingResponseServiceError(t *testing.T) {
+	if _, err := parsePollingResponse([]byte(`{"status":0,"request":"ERROR_WRONG_USER_KEY"}`)); err == nil {
+		t.Fatalf("expected error when status=0 and request is not CAPCHA_NOT_READY")
+	}
+}
+
+func TestParsePollingResponseInvalidJSON(t *testing.T) {
+	if _, err := parsePollingResponse([]byte(`not json`)); err == nil {
+		t.Fatalf("expected error for invalid JSON")
+	}
+}
+
+// newTestSolver запускает httptest-сервер, имитирующий протокол
+// in.php/res.php, и возвращает pollingSolver, указывающий на него.
+func newTestSolver(t *testing.T, handler http.HandlerFunc) *pollingSolver {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return &pollingSolver{
+		name:       "test",
+		baseURL:    srv.URL,
+		apiKey:     "key",
+		timeout:    time.Second,
+		httpClient: srv.Client(),
+	}
+}
+
+// Solve ждёт 5 секунд перед каждым опросом res.php (см. solver.go), так
+// что здесь проверяется только один цикл опроса, а не многократный
+// ретрай — иначе тест занимал бы десятки секунд.
+func TestSolveSubmitsAndPollsUntilReady(t *testing.T) {
+	var polls int
+	s := newTestSolver(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/in.php":
+			json.NewEncoder(w).Encode(pollingResponse{Status: 1, Request: "task-1"})
+		case "/res.php":
+			polls++
+			json.NewEncoder(w).Encode(pollingResponse{Status: 1, Request: "solved-token"})
+		default:
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+	})
+	s.timeout = 10 * time.Second
+
+	sol, err := s.Solve(context.Background(), Challenge{Type: ChallengeRecaptchaV2, SiteKey: "sk", PageURL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("Solve: %v", err)
+	}
+	if sol.Token != "solved-token" {
+		t.Fatalf("token = %q, want solved-token", sol.Token)
+	}
+	if polls != 1 {
+		t.Fatalf("expected exactly 1 poll, got %d", polls)
+	}
+}
+
+func TestSolveSubmitErrorPropagates(t *testing.T) {
+	s := newTestSolver(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(pollingResponse{Status: 0, Request: "ERROR_ZERO_BALANCE"})
+	})
+
+	if _, err := s.Solve(context.Background(), Challenge{Type: ChallengeRecaptchaV2}); err == nil {
+		t.Fatalf("expected error when in.php rejects the task")
+	}
+}
+
+func TestSolveUnsupportedChallengeTypeFailsBeforeAnyRequest(t *testing.T) {
+	called := false
+	s := newTestSolver(t, func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	if _, err := s.Solve(context.Background(), Challenge{Type: ChallengeType("unknown")}); err == nil {
+		t.Fatalf("expected error for unsupported challenge type")
+	}
+	if called {
+		t.Fatalf("Solve must not hit the network for an unsupported challenge type")
+	}
+}
+
+func TestSolveTimesOutIfNeverReady(t *testing.T) {
+	s := newTestSolver(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/in.php":
+			json.NewEncoder(w).Encode(pollingResponse{Status: 1, Request: "task-1"})
+		case "/res.php":
+			json.NewEncoder(w).Encode(pollingResponse{Status: 0, Request: "CAPCHA_NOT_READY"})
+		}
+	})
+	s.timeout = 50 * time.Millisecond
+
+	// Solve всегда ждёт 5 секунд перед очередным опросом, поэтому
+	// единственный быстрый способ воспроизвести истечение таймаута в
+	// тесте — отменить контекст раньше, чем сработает этот интервал.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := s.Solve(ctx, Challenge{Type: ChallengeRecaptchaV2}); err == nil {
+		t.Fatalf("expected an error when the solution never becomes ready")
+	}
+}
@@ -0,0 +1,55 @@
+// Package tracing настраивает глобальный OpenTelemetry TracerProvider
+// для процесса: при заданном OTLP-эндпоинте шлёт спаны по OTLP/gRPC,
+// а при пустом — устанавливает no-op провайдер, чтобы остальной код мог
+// безусловно создавать спаны без проверки "включён ли трейсинг".
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const serviceName = "avito-parser"
+
+// Init настраивает глобальный TracerProvider. Если endpoint пуст,
+// устанавливается no-op провайдер (спаны создаются, но никуда не
+// отправляются) — это позволяет остальному коду не ветвиться на
+// "трейсинг включён/выключен". Возвращённую shutdown-функцию нужно
+// вызвать перед завершением процесса, чтобы дотянуть буфер спанов.
+func Init(endpoint string) (shutdown func(context.Context) error, err error) {
+	if endpoint == "" {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		return func(context.Context) error { return nil }, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать OTLP-экспортёр (%s): %w", endpoint, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("не удалось собрать ресурс трейсинга: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}